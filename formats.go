@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/swag"
+)
+
+// fieldSpec captures the validation-relevant properties that spec.Header,
+// spec.Parameter and spec.Items all expose under the same names, so header,
+// query, path and array-item values can all be validated through one code
+// path.
+type fieldSpec struct {
+	Type             string
+	Format           string
+	Pattern          string
+	Enum             []interface{}
+	Maximum          *float64
+	ExclusiveMaximum bool
+	Minimum          *float64
+	ExclusiveMinimum bool
+	MaxLength        *int64
+	MinLength        *int64
+	CollectionFormat string
+	Items            *spec.Items
+}
+
+func headerFieldSpec(h *spec.Header) fieldSpec {
+	return fieldSpec{
+		Type: h.Type, Format: h.Format, Pattern: h.Pattern, Enum: h.Enum,
+		Maximum: h.Maximum, ExclusiveMaximum: h.ExclusiveMaximum,
+		Minimum: h.Minimum, ExclusiveMinimum: h.ExclusiveMinimum,
+		MaxLength: h.MaxLength, MinLength: h.MinLength,
+		CollectionFormat: h.CollectionFormat, Items: h.Items,
+	}
+}
+
+func parameterFieldSpec(p *spec.Parameter) fieldSpec {
+	return fieldSpec{
+		Type: p.Type, Format: p.Format, Pattern: p.Pattern, Enum: p.Enum,
+		Maximum: p.Maximum, ExclusiveMaximum: p.ExclusiveMaximum,
+		Minimum: p.Minimum, ExclusiveMinimum: p.ExclusiveMinimum,
+		MaxLength: p.MaxLength, MinLength: p.MinLength,
+		CollectionFormat: p.CollectionFormat, Items: p.Items,
+	}
+}
+
+func itemsFieldSpec(items *spec.Items) fieldSpec {
+	return fieldSpec{
+		Type: items.Type, Format: items.Format, Pattern: items.Pattern, Enum: items.Enum,
+		Maximum: items.Maximum, ExclusiveMaximum: items.ExclusiveMaximum,
+		Minimum: items.Minimum, ExclusiveMinimum: items.ExclusiveMinimum,
+		MaxLength: items.MaxLength, MinLength: items.MinLength,
+	}
+}
+
+// validateHeaderValue validates a response header's value against spec,
+// requiring it to be present.
+func (proxy *Proxy) validateHeaderValue(key, value string, spec *spec.Header) error {
+	if value == "" {
+		return fmt.Errorf("%s in headers is missing", key)
+	}
+	return proxy.validateFieldValue(key, "headers", value, headerFieldSpec(spec))
+}
+
+// validateFieldValue validates value (already known to be present) against
+// f's Type, Format, Pattern, Enum, Maximum/Minimum, MaxLength/MinLength and,
+// for array fields, CollectionFormat.
+func (proxy *Proxy) validateFieldValue(name, in, value string, f fieldSpec) error {
+	if f.Type == "array" {
+		return proxy.validateArrayValue(name, in, value, f)
+	}
+	return proxy.validateScalarValue(name, in, value, f)
+}
+
+func (proxy *Proxy) validateArrayValue(name, in, value string, f fieldSpec) error {
+	if f.Items == nil {
+		return nil
+	}
+	item := itemsFieldSpec(f.Items)
+
+	// "multi" means the parameter appears as several distinct query/form
+	// values, each already split out by the caller: validate value as a
+	// single item instead of splitting it further.
+	if f.CollectionFormat == "multi" {
+		return proxy.validateScalarValue(name, in, value, item)
+	}
+
+	for _, v := range splitCollection(f.CollectionFormat, value) {
+		if err := proxy.validateScalarValue(name, in, v, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitCollection splits a collection-valued header/parameter value per the
+// swagger 2.0 collectionFormat rules. "csv" is the default when format is
+// empty.
+func splitCollection(format, value string) []string {
+	switch format {
+	case "ssv":
+		return strings.Split(value, " ")
+	case "tsv":
+		return strings.Split(value, "\t")
+	case "pipes":
+		return strings.Split(value, "|")
+	default: // "csv" and unset
+		return strings.Split(value, ",")
+	}
+}
+
+func (proxy *Proxy) validateScalarValue(name, in, value string, f fieldSpec) error {
+	if err := proxy.validateFormat(value, f.Format); err != nil {
+		return fmt.Errorf("%s in %s: %v", name, in, err)
+	}
+
+	if f.Pattern != "" {
+		re, err := proxy.pattern(f.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s in %s: %v", name, in, err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("%s in %s must match pattern %q", name, in, f.Pattern)
+		}
+	}
+
+	if len(f.Enum) > 0 && !enumContains(f.Enum, value) {
+		return fmt.Errorf("%s in %s must be one of %v", name, in, f.Enum)
+	}
+
+	if f.MaxLength != nil && int64(len(value)) > *f.MaxLength {
+		return fmt.Errorf("%s in %s is longer than %d", name, in, *f.MaxLength)
+	}
+	if f.MinLength != nil && int64(len(value)) < *f.MinLength {
+		return fmt.Errorf("%s in %s is shorter than %d", name, in, *f.MinLength)
+	}
+
+	if f.Maximum != nil || f.Minimum != nil {
+		n, err := swag.ConvertFloat64(value)
+		if err != nil {
+			return fmt.Errorf("%s in %s: %v", name, in, err)
+		}
+		if f.Maximum != nil && (n > *f.Maximum || (f.ExclusiveMaximum && n == *f.Maximum)) {
+			return fmt.Errorf("%s in %s must be <= %v", name, in, *f.Maximum)
+		}
+		if f.Minimum != nil && (n < *f.Minimum || (f.ExclusiveMinimum && n == *f.Minimum)) {
+			return fmt.Errorf("%s in %s must be >= %v", name, in, *f.Minimum)
+		}
+	}
+
+	return nil
+}
+
+// validateFormat checks value against format, preferring the fast numeric
+// conversions for the formats swagger 2.0 defines natively and falling back to the proxy's
+// strfmt registry for everything else (date-time, uuid, email, ...).
+func (proxy *Proxy) validateFormat(value, format string) error {
+	switch format {
+	case "":
+		return nil
+	case "int32":
+		_, err := swag.ConvertInt32(value)
+		return err
+	case "int64":
+		_, err := swag.ConvertInt64(value)
+		return err
+	case "float", "double":
+		_, err := swag.ConvertFloat64(value)
+		return err
+	}
+
+	if proxy.formats.ContainsName(format) && !proxy.formats.Validates(format, value) {
+		return fmt.Errorf("invalid %s: %q", format, value)
+	}
+	return nil
+}
+
+func enumContains(enum []interface{}, value string) bool {
+	for _, e := range enum {
+		if fmt.Sprintf("%v", e) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// pattern compiles expr, caching the result so a spec's patterns are only
+// ever compiled once. Requests are served concurrently, so the cache is
+// guarded by patternsMu.
+func (proxy *Proxy) pattern(expr string) (*regexp.Regexp, error) {
+	proxy.patternsMu.RLock()
+	re, ok := proxy.patterns[expr]
+	proxy.patternsMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy.patternsMu.Lock()
+	if proxy.patterns == nil {
+		proxy.patterns = make(map[string]*regexp.Regexp)
+	}
+	proxy.patterns[expr] = re
+	proxy.patternsMu.Unlock()
+	return re, nil
+}
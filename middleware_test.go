@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/gorilla/mux"
+)
+
+// atomicReporter is a Reporter safe for concurrent use, for tests that hit
+// the proxy from multiple goroutines.
+type atomicReporter struct {
+	successes atomic.Int64
+}
+
+func (r *atomicReporter) Success(req *http.Request)                      { r.successes.Add(1) }
+func (r *atomicReporter) Warning(req *http.Request, msg string)          {}
+func (r *atomicReporter) Error(req *http.Request, err error)             {}
+func (r *atomicReporter) Retry(req *http.Request, attempt int, err error) {}
+
+func singleGetSwagger(path string) *spec.Swagger {
+	return &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger: "2.0",
+			Paths: &spec.Paths{
+				Paths: map[string]spec.PathItem{
+					path: {PathItemProps: spec.PathItemProps{Get: okOperation()}},
+				},
+			},
+		},
+	}
+}
+
+func TestUseStacksMiddlewareInOrder(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	reporter := &recordingReporter{}
+	proxy, err := New(singleGetSwagger("/widgets"), reporter, WithTarget(upstream.URL))
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	var order []string
+	mark := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	proxy.Use(mark("first"), mark("second"))
+
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	proxy.Router().ServeHTTP(rec, req)
+
+	if got, want := strings.Join(order, ","), "first,second"; got != want {
+		t.Errorf("got middleware order %q, want %q", got, want)
+	}
+	if reporter.successes != 1 {
+		t.Errorf("got %d successes, want 1", reporter.successes)
+	}
+}
+
+// TestChainIsSafeForConcurrentFirstRequests reproduces the data race fixed
+// in handlerMu: many requests hitting dispatch() simultaneously, before the
+// middleware chain has been built once, used to race on proxy.handler.
+func TestChainIsSafeForConcurrentFirstRequests(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	reporter := &atomicReporter{}
+	proxy, err := New(singleGetSwagger("/widgets"), reporter, WithTarget(upstream.URL))
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	proxy.Use(func(next http.Handler) http.Handler { return next })
+
+	const n = 50
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/widgets", nil)
+			rec := httptest.NewRecorder()
+			proxy.Router().ServeHTTP(rec, req)
+		}()
+	}
+	wg.Wait()
+
+	if got := reporter.successes.Load(); got != n {
+		t.Errorf("got %d successes, want %d", got, n)
+	}
+}
+
+func TestValidatorMiddlewareWrapsExternalRouter(t *testing.T) {
+	reporter := &recordingReporter{}
+
+	var called bool
+	final := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	})
+
+	router := mux.NewRouter()
+	router.Use(ValidatorMiddleware(singleGetSwagger("/widgets"), reporter))
+	router.Handle("/widgets", final).Methods("GET")
+
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if !called {
+		t.Error("expected the wrapped handler to be called")
+	}
+	if reporter.successes != 1 {
+		t.Errorf("got %d successes, want 1", reporter.successes)
+	}
+}
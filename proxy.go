@@ -1,30 +1,46 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/go-openapi/errors"
 	"github.com/go-openapi/spec"
 	"github.com/go-openapi/strfmt"
-	"github.com/go-openapi/swag"
 	"github.com/go-openapi/validate"
 	"github.com/gorilla/mux"
 )
 
 type Proxy struct {
 	// Opts
-	target  string
-	verbose bool
+	target                string
+	verbose               bool
+	validateRequests      bool
+	requestValidationMode RequestValidationMode
+	retries               int
+	retryBackoff          time.Duration
+	formats               strfmt.Registry
 
 	router       *mux.Router
 	routes       map[*mux.Route]*spec.Operation
 	reverseProxy http.Handler
 
+	handlerMu   sync.RWMutex
+	middlewares []func(http.Handler) http.Handler
+	handler     http.Handler // cached composed middlewares + validating handler; guarded by handlerMu
+
+	patternsMu sync.RWMutex
+	patterns   map[string]*regexp.Regexp // compiled Pattern validators, keyed by expression; guarded by patternsMu
+
 	reporter Reporter
 	doc      interface{} // This is useful for validate (TODO: find a better way)
 }
@@ -34,7 +50,43 @@ type ProxyOpt func(*Proxy)
 func WithTarget(target string) ProxyOpt { return func(proxy *Proxy) { proxy.target = target } }
 func WithVerbose(v bool) ProxyOpt       { return func(proxy *Proxy) { proxy.verbose = v } }
 
-func New(s *spec.Swagger, reporter Reporter, opts ...ProxyOpt) (*Proxy, error) {
+// WithRequestValidation enables validating incoming requests against the
+// operation's parameters and body schema, in addition to the existing
+// response validation.
+func WithRequestValidation(v bool) ProxyOpt {
+	return func(proxy *Proxy) { proxy.validateRequests = v }
+}
+
+// WithRequestValidationMode controls what happens when an incoming request
+// fails validation. It has no effect unless WithRequestValidation(true) is
+// also set.
+func WithRequestValidationMode(mode RequestValidationMode) ProxyOpt {
+	return func(proxy *Proxy) { proxy.requestValidationMode = mode }
+}
+
+// WithRetry re-issues the upstream request up to n times, with exponential
+// backoff starting at backoff, whenever the response fails validation
+// (either an unexpected status or a schema/header mismatch). Only the final
+// attempt's response reaches the client and the Reporter's Success/Error
+// hooks; every attempt that gets retried is reported through Reporter.Retry.
+func WithRetry(n int, backoff time.Duration) ProxyOpt {
+	return func(proxy *Proxy) {
+		proxy.retries = n
+		proxy.retryBackoff = backoff
+	}
+}
+
+// WithFormats overrides the strfmt registry used to validate header, query
+// and path parameter formats (date-time, uuid, email, ...). Defaults to
+// strfmt.Default.
+func WithFormats(formats strfmt.Registry) ProxyOpt {
+	return func(proxy *Proxy) { proxy.formats = formats }
+}
+
+// newProxy builds the part of a Proxy that's shared between New (which owns
+// its own router and reverse proxy) and ValidatorMiddleware (which only
+// needs spec-aware route matching to validate someone else's handler).
+func newProxy(s *spec.Swagger, reporter Reporter, opts ...ProxyOpt) (*Proxy, error) {
 	// validate.NewSchemaValidator requires the spec as an interface{}
 	// That's why we Unmarshal(Marshal()) the document
 	data, err := json.Marshal(s)
@@ -53,38 +105,101 @@ func New(s *spec.Swagger, reporter Reporter, opts ...ProxyOpt) (*Proxy, error) {
 		routes:   make(map[*mux.Route]*spec.Operation),
 		reporter: reporter,
 		doc:      doc,
+		formats:  strfmt.Default,
 	}
 
 	for _, opt := range opts {
 		opt(proxy)
 	}
 
+	proxy.router.NotFoundHandler = http.HandlerFunc(proxy.notFound)
+	// A path registered for some verbs but requested with another (e.g. only
+	// GET/POST declared, DELETE requested) must be reported the same way as
+	// a path that isn't in the spec at all, instead of gorilla/mux's default
+	// bare 405.
+	proxy.router.MethodNotAllowedHandler = http.HandlerFunc(proxy.notFound)
+	proxy.registerPaths(s.BasePath, s.Paths)
+
+	return proxy, nil
+}
+
+func New(s *spec.Swagger, reporter Reporter, opts ...ProxyOpt) (*Proxy, error) {
+	proxy, err := newProxy(s, reporter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	rpURL, err := url.Parse(proxy.target)
 	if err != nil {
 		return nil, err
 	}
 	proxy.reverseProxy = httputil.NewSingleHostReverseProxy(rpURL)
 
-	proxy.router.NotFoundHandler = http.HandlerFunc(proxy.notFound)
-	proxy.registerPaths(s.BasePath, s.Paths)
-
 	return proxy, nil
 }
 
+// ValidatorMiddleware returns a gorilla/mux compatible middleware that
+// validates requests and responses against s, for consumers who already
+// have their own *mux.Router and don't want to adopt ours. Plug it in with
+// router.Use(proxy.ValidatorMiddleware(s, reporter)).
+func ValidatorMiddleware(s *spec.Swagger, reporter Reporter, opts ...ProxyOpt) mux.MiddlewareFunc {
+	proxy, err := newProxy(s, reporter, opts...)
+	if err != nil {
+		// mux.MiddlewareFunc has no error return; fail fast like template.Must.
+		panic(err)
+	}
+
+	return proxy.Handler
+}
+
 func (proxy *Proxy) Router() http.Handler {
 	return proxy.router
 }
 
+// Use stacks mw in front of the validating handler for every registered
+// route, in the order given. Call it before the Proxy starts serving
+// requests.
+func (proxy *Proxy) Use(mw ...func(http.Handler) http.Handler) {
+	proxy.handlerMu.Lock()
+	defer proxy.handlerMu.Unlock()
+	proxy.middlewares = append(proxy.middlewares, mw...)
+	proxy.handler = nil
+}
+
+// chain composes the user middlewares registered via Use on top of the
+// validating handler, building it once and caching it until Use is called
+// again. Requests are served concurrently, so the cache is guarded by
+// handlerMu.
+func (proxy *Proxy) chain() http.Handler {
+	proxy.handlerMu.RLock()
+	h := proxy.handler
+	proxy.handlerMu.RUnlock()
+	if h != nil {
+		return h
+	}
+
+	proxy.handlerMu.Lock()
+	defer proxy.handlerMu.Unlock()
+	if proxy.handler == nil {
+		h := proxy.Handler(proxy.reverseProxy)
+		for i := len(proxy.middlewares) - 1; i >= 0; i-- {
+			h = proxy.middlewares[i](h)
+		}
+		proxy.handler = h
+	}
+	return proxy.handler
+}
+
 func (proxy *Proxy) registerPaths(base string, paths *spec.Paths) {
 	for path, item := range paths.Paths {
-		// Register every spec operation under a newHandler
+		// Register every spec operation under a dispatching handler
 		for method, op := range getOperations(&item) {
 			newPath := base + path
 			if proxy.verbose {
 				log.Printf("Register %s %s", method, newPath)
 			}
 			route := proxy.router.Handle(
-				newPath, proxy.newHandler(),
+				newPath, http.HandlerFunc(proxy.dispatch),
 			).Methods(method)
 			proxy.routes[route] = op
 		}
@@ -96,9 +211,15 @@ func (proxy *Proxy) notFound(w http.ResponseWriter, req *http.Request) {
 	proxy.reverseProxy.ServeHTTP(w, req)
 }
 
-func (proxy *Proxy) newHandler() http.Handler {
-	return proxy.Handler(proxy.reverseProxy)
+// dispatch serves a request matched to one of our own routes, running it
+// through any middlewares registered via Use.
+func (proxy *Proxy) dispatch(w http.ResponseWriter, req *http.Request) {
+	proxy.chain().ServeHTTP(w, req)
 }
+
+// Handler wraps next with request/response validation against the spec.
+// next doesn't have to be our internal reverse proxy: it can be any handler
+// a caller wants validated, which is what makes ValidatorMiddleware possible.
 func (proxy *Proxy) Handler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, req *http.Request) {
 		var match mux.RouteMatch
@@ -107,21 +228,28 @@ func (proxy *Proxy) Handler(next http.Handler) http.Handler {
 
 		if match.Handler == nil || op == nil {
 			proxy.reporter.Warning(req, "Route not defined on the Spec")
-			// Route hasn't been registered on the muxer
+			next.ServeHTTP(w, req)
 			return
 		}
 
-		wr := &WriterRecorder{ResponseWriter: w}
-		next.ServeHTTP(wr, req)
+		if proxy.validateRequests {
+			if err := proxy.ValidateRequest(req, op); err != nil {
+				proxy.reporter.Error(req, err)
+				if proxy.requestValidationMode == ModeBlock {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
 
-		specResp, ok := op.Responses.StatusCodeResponses[wr.Status()]
-		if !ok {
-			err := fmt.Errorf("Server Status %d not defined by the spec", wr.Status())
-			proxy.reporter.Error(req, err)
-			return
+		wr, err := proxy.serveWithRetry(w, req, next, op)
+		if wr.buffered {
+			if cerr := wr.Commit(); cerr != nil && err == nil {
+				err = cerr
+			}
 		}
 
-		if err := proxy.Validate(wr.Status(), wr.Header(), wr.Body(), &specResp); err != nil {
+		if err != nil {
 			proxy.reporter.Error(req, err)
 		} else {
 			proxy.reporter.Success(req)
@@ -130,6 +258,65 @@ func (proxy *Proxy) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// serveWithRetry calls next and validates its response against op, retrying
+// up to proxy.retries times with exponential backoff while validation
+// fails. Only the last attempt's WriterRecorder is returned; every
+// earlier attempt is reported through Reporter.Retry.
+func (proxy *Proxy) serveWithRetry(w http.ResponseWriter, req *http.Request, next http.Handler, op *spec.Operation) (*WriterRecorder, error) {
+	var reqBody []byte
+	var baseHeader http.Header
+	if proxy.retries > 0 {
+		if req.Body != nil {
+			reqBody, _ = io.ReadAll(req.Body)
+		}
+		baseHeader = w.Header().Clone()
+	}
+
+	var wr *WriterRecorder
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if reqBody != nil {
+			req.Body = io.NopCloser(bytes.NewReader(reqBody))
+		}
+		if attempt > 0 {
+			// Drop the headers a retried attempt set on w, so only the last
+			// attempt's headers reach the client.
+			h := w.Header()
+			for k := range h {
+				delete(h, k)
+			}
+			for k, v := range baseHeader {
+				h[k] = v
+			}
+		}
+
+		if proxy.retries > 0 {
+			wr = NewBufferedWriterRecorder(w)
+		} else {
+			wr = &WriterRecorder{ResponseWriter: w}
+		}
+		next.ServeHTTP(wr, req)
+
+		lastErr = proxy.validateResponse(wr, op)
+		if lastErr == nil || attempt >= proxy.retries {
+			return wr, lastErr
+		}
+
+		proxy.reporter.Retry(req, attempt+1, lastErr)
+		time.Sleep(proxy.retryBackoff * time.Duration(1<<attempt))
+	}
+}
+
+// validateResponse checks a single attempt's recorded response against the
+// operation's declared responses.
+func (proxy *Proxy) validateResponse(wr *WriterRecorder, op *spec.Operation) error {
+	specResp, ok := op.Responses.StatusCodeResponses[wr.Status()]
+	if !ok {
+		return fmt.Errorf("Server Status %d not defined by the spec", wr.Status())
+	}
+	return proxy.Validate(wr.Status(), wr.Header(), wr.Body(), &specResp)
+}
+
 func (proxy *Proxy) Validate(status int, header http.Header, body []byte, resp *spec.Response) error {
 	var data interface{}
 	if err := json.Unmarshal(body, &data); err != nil {
@@ -138,7 +325,7 @@ func (proxy *Proxy) Validate(status int, header http.Header, body []byte, resp *
 
 	var errs []error
 	for key, val := range resp.Headers {
-		if err := validateHeaderValue(key, header.Get(key), &val); err != nil {
+		if err := proxy.validateHeaderValue(key, header.Get(key), &val); err != nil {
 			errs = append(errs, err)
 		}
 	}
@@ -158,39 +345,30 @@ func (proxy *Proxy) Validate(status int, header http.Header, body []byte, resp *
 	return errors.CompositeValidationError(errs...)
 }
 
-func validateHeaderValue(key, value string, spec *spec.Header) error {
-	if value == "" {
-		return fmt.Errorf("%s in headers is missing", key)
-	}
-
-	// TODO: Implement the rest of the format validators
-	switch spec.Format {
-	case "int32":
-		_, err := swag.ConvertInt32(value)
-		return err
-	case "date-time":
-		_, err := strfmt.ParseDateTime(value)
-		return err
-	}
-	return nil
-}
-
 func getOperations(props *spec.PathItem) map[string]*spec.Operation {
 	ops := make(map[string]*spec.Operation)
 
+	// Every operation defined on the PathItem must be registered
+	// independently: a path can (and often does) declare more than one verb.
 	if props.Delete != nil {
 		ops["DELETE"] = props.Delete
-	} else if props.Get != nil {
+	}
+	if props.Get != nil {
 		ops["GET"] = props.Get
-	} else if props.Head != nil {
+	}
+	if props.Head != nil {
 		ops["HEAD"] = props.Head
-	} else if props.Options != nil {
+	}
+	if props.Options != nil {
 		ops["OPTIONS"] = props.Options
-	} else if props.Patch != nil {
+	}
+	if props.Patch != nil {
 		ops["PATCH"] = props.Patch
-	} else if props.Post != nil {
+	}
+	if props.Post != nil {
 		ops["POST"] = props.Post
-	} else if props.Put != nil {
+	}
+	if props.Put != nil {
 		ops["PUT"] = props.Put
 	}
 
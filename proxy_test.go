@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+type recordingReporter struct {
+	successes int
+	warnings  []string
+	errors    []error
+	retries   int
+}
+
+func (r *recordingReporter) Success(req *http.Request)             { r.successes++ }
+func (r *recordingReporter) Warning(req *http.Request, msg string) { r.warnings = append(r.warnings, msg) }
+func (r *recordingReporter) Error(req *http.Request, err error)    { r.errors = append(r.errors, err) }
+func (r *recordingReporter) Retry(req *http.Request, attempt int, err error) { r.retries++ }
+
+func okOperation() *spec.Operation {
+	return &spec.Operation{
+		OperationProps: spec.OperationProps{
+			Responses: &spec.Responses{
+				ResponsesProps: spec.ResponsesProps{
+					StatusCodeResponses: map[int]spec.Response{
+						200: {},
+					},
+				},
+			},
+		},
+	}
+}
+
+// TestGetOperationsRegistersEveryMethod is a regression test for a path
+// declaring more than one verb: every operation must be matched and
+// validated independently, not just the first one in the else-if cascade.
+func TestGetOperationsRegistersEveryMethod(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	item := spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Get:  okOperation(),
+			Post: okOperation(),
+		},
+	}
+	swagger := &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger: "2.0",
+			Paths: &spec.Paths{
+				Paths: map[string]spec.PathItem{"/widgets": item},
+			},
+		},
+	}
+
+	reporter := &recordingReporter{}
+	proxy, err := New(swagger, reporter, WithTarget(upstream.URL))
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		req := httptest.NewRequest(method, "/widgets", nil)
+		rec := httptest.NewRecorder()
+		proxy.Router().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s /widgets: got status %d, want %d", method, rec.Code, http.StatusOK)
+		}
+	}
+
+	if reporter.successes != 2 {
+		t.Errorf("got %d successes, want 2 (one per method)", reporter.successes)
+	}
+	if len(reporter.warnings) != 0 || len(reporter.errors) != 0 {
+		t.Errorf("unexpected warnings=%v errors=%v", reporter.warnings, reporter.errors)
+	}
+
+	// DELETE was never declared on the path, so it must fall through to the
+	// not-found handler instead of matching GET or POST.
+	req := httptest.NewRequest("DELETE", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	proxy.Router().ServeHTTP(rec, req)
+	if len(reporter.warnings) != 1 {
+		t.Errorf("got %d warnings after DELETE, want 1", len(reporter.warnings))
+	}
+}
@@ -0,0 +1,13 @@
+package proxy
+
+import "net/http"
+
+// Reporter is notified about the outcome of validating a proxied request.
+type Reporter interface {
+	Success(req *http.Request)
+	Warning(req *http.Request, msg string)
+	Error(req *http.Request, err error)
+	// Retry is called for every attempt that failed validation but was
+	// retried, right before the proxy re-issues req to the upstream.
+	Retry(req *http.Request, attempt int, err error)
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-openapi/errors"
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+	"github.com/gorilla/mux"
+)
+
+// RequestValidationMode controls how the proxy reacts to a request that
+// fails validation.
+type RequestValidationMode int
+
+const (
+	// ModeReport only reports the validation failure through the Reporter,
+	// the request still reaches the upstream.
+	ModeReport RequestValidationMode = iota
+	// ModeBlock short-circuits the request with a 400 response instead of
+	// forwarding it upstream.
+	ModeBlock
+)
+
+// ValidateRequest checks req's path, query, header, formData and body
+// parameters against op, returning a single error aggregating every
+// violation found.
+func (proxy *Proxy) ValidateRequest(req *http.Request, op *spec.Operation) error {
+	var match mux.RouteMatch
+	proxy.router.Match(req, &match)
+
+	var errs []error
+	for i := range op.Parameters {
+		param := &op.Parameters[i]
+
+		switch param.In {
+		case "path":
+			value, ok := match.Vars[param.Name]
+			if !ok {
+				if param.Required {
+					errs = append(errs, fmt.Errorf("%s in path is missing", param.Name))
+				}
+				continue
+			}
+			if err := proxy.validateFieldValue(param.Name, "path", value, parameterFieldSpec(param)); err != nil {
+				errs = append(errs, err)
+			}
+		case "query":
+			values, ok := req.URL.Query()[param.Name]
+			if !ok {
+				if param.Required {
+					errs = append(errs, fmt.Errorf("%s in query is missing", param.Name))
+				}
+				continue
+			}
+			errs = append(errs, proxy.validateParamValues(param, "query", values)...)
+		case "header":
+			values := req.Header.Values(param.Name)
+			if values == nil {
+				if param.Required {
+					errs = append(errs, fmt.Errorf("%s in header is missing", param.Name))
+				}
+				continue
+			}
+			errs = append(errs, proxy.validateParamValues(param, "header", values)...)
+		case "formData":
+			if err := req.ParseForm(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			values, ok := req.Form[param.Name]
+			if !ok {
+				if param.Required {
+					errs = append(errs, fmt.Errorf("%s in formData is missing", param.Name))
+				}
+				continue
+			}
+			errs = append(errs, proxy.validateParamValues(param, "formData", values)...)
+		case "body":
+			if err := proxy.validateRequestBody(req, op, param.Schema); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.CompositeValidationError(errs...)
+}
+
+// validateParamValues validates every instance of a repeated-key parameter
+// (collectionFormat: multi), since each instance is a distinct array item
+// rather than a single delimited value. Any other param only ever has one
+// instance to validate, values[0].
+func (proxy *Proxy) validateParamValues(param *spec.Parameter, in string, values []string) []error {
+	if param.Type != "array" || param.CollectionFormat != "multi" {
+		values = values[:1]
+	}
+
+	var errs []error
+	for _, value := range values {
+		if err := proxy.validateFieldValue(param.Name, in, value, parameterFieldSpec(param)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// validateRequestBody decodes req's body according to the operation's
+// consumed content type and restores req.Body afterwards so it can still be
+// forwarded upstream.
+func (proxy *Proxy) validateRequestBody(req *http.Request, op *spec.Operation, schema *spec.Schema) error {
+	if schema == nil || req.Body == nil {
+		return nil
+	}
+
+	if !consumesJSON(req, op) {
+		// We only know how to decode JSON bodies; anything else (form
+		// encoding, XML, ...) is left to the upstream to validate.
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return err
+	}
+
+	validator := validate.NewSchemaValidator(schema, proxy.doc, "", strfmt.NewFormats())
+	result := validator.Validate(data)
+	if result.HasErrors() {
+		return errors.CompositeValidationError(result.Errors...)
+	}
+	return nil
+}
+
+// consumesJSON reports whether req's body should be treated as JSON, per
+// the operation's Consumes list (falling back to the request's own
+// Content-Type when the operation doesn't declare one).
+func consumesJSON(req *http.Request, op *spec.Operation) bool {
+	consumes := op.Consumes
+	if len(consumes) == 0 {
+		if ct := req.Header.Get("Content-Type"); ct != "" {
+			consumes = []string{ct}
+		}
+	}
+	if len(consumes) == 0 {
+		return true
+	}
+
+	for _, raw := range consumes {
+		mediaType := raw
+		if parsed, _, err := mime.ParseMediaType(raw); err == nil {
+			mediaType = parsed
+		}
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func operationWithQueryParam(required bool) *spec.Operation {
+	op := okOperation()
+	op.Parameters = []spec.Parameter{
+		{
+			ParamProps: spec.ParamProps{Name: "name", In: "query", Required: required},
+			SimpleSchema: spec.SimpleSchema{
+				Type: "string",
+			},
+		},
+	}
+	return op
+}
+
+func TestValidateRequestDistinguishesMissingFromEmptyQueryParam(t *testing.T) {
+	swagger := &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger: "2.0",
+			Paths: &spec.Paths{
+				Paths: map[string]spec.PathItem{
+					"/widgets": {PathItemProps: spec.PathItemProps{Get: operationWithQueryParam(true)}},
+				},
+			},
+		},
+	}
+
+	proxy, err := New(swagger, &recordingReporter{}, WithRequestValidation(true))
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	op := swagger.Paths.Paths["/widgets"].Get
+
+	// Not sent at all: required and missing.
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	if err := proxy.ValidateRequest(req, op); err == nil {
+		t.Error("expected an error for a missing required query param, got nil")
+	}
+
+	// Sent with an empty value: present, spec-legal for a string param.
+	req = httptest.NewRequest("GET", "/widgets?name=", nil)
+	if err := proxy.ValidateRequest(req, op); err != nil {
+		t.Errorf("unexpected error for an empty-but-present query param: %v", err)
+	}
+}
+
+func operationWithMultiUUIDQueryParam() *spec.Operation {
+	op := okOperation()
+	op.Parameters = []spec.Parameter{
+		{
+			ParamProps: spec.ParamProps{Name: "tags", In: "query"},
+			SimpleSchema: spec.SimpleSchema{
+				Type:             "array",
+				CollectionFormat: "multi",
+				Items:            &spec.Items{SimpleSchema: spec.SimpleSchema{Type: "string", Format: "uuid"}},
+			},
+		},
+	}
+	return op
+}
+
+func TestValidateRequestValidatesEveryMultiValuedQueryParam(t *testing.T) {
+	swagger := &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger: "2.0",
+			Paths: &spec.Paths{
+				Paths: map[string]spec.PathItem{
+					"/widgets": {PathItemProps: spec.PathItemProps{Get: operationWithMultiUUIDQueryParam()}},
+				},
+			},
+		},
+	}
+
+	proxy, err := New(swagger, &recordingReporter{}, WithRequestValidation(true))
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	op := swagger.Paths.Paths["/widgets"].Get
+
+	req := httptest.NewRequest("GET", "/widgets?tags=ba7c0916-3b2e-4ad7-8f44-2a5af64c3e0e&tags=not-a-uuid", nil)
+	if err := proxy.ValidateRequest(req, op); err == nil {
+		t.Error("expected an error for the second, invalid tags value, got nil")
+	}
+}
+
+func TestValidateRequestModeBlockRejectsMissingParam(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Error("upstream should not be reached when the request is blocked")
+	}))
+	defer upstream.Close()
+
+	swagger := &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger: "2.0",
+			Paths: &spec.Paths{
+				Paths: map[string]spec.PathItem{
+					"/widgets": {PathItemProps: spec.PathItemProps{Get: operationWithQueryParam(true)}},
+				},
+			},
+		},
+	}
+
+	reporter := &recordingReporter{}
+	proxy, err := New(swagger, reporter,
+		WithTarget(upstream.URL),
+		WithRequestValidation(true),
+		WithRequestValidationMode(ModeBlock),
+	)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	proxy.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if len(reporter.errors) != 1 {
+		t.Errorf("got %d reported errors, want 1", len(reporter.errors))
+	}
+}
+
+func TestConsumesJSONSkipsNonJSONBodies(t *testing.T) {
+	op := &spec.Operation{OperationProps: spec.OperationProps{Consumes: []string{"application/x-www-form-urlencoded"}}}
+	req := httptest.NewRequest("POST", "/widgets", strings.NewReader("name=foo"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if consumesJSON(req, op) {
+		t.Error("expected a form-encoded operation not to be treated as JSON")
+	}
+
+	op = &spec.Operation{OperationProps: spec.OperationProps{Consumes: []string{"application/json; charset=utf-8"}}}
+	if !consumesJSON(req, op) {
+		t.Error("expected application/json (with params) to be treated as JSON")
+	}
+}
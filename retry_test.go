@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryRetriesUntilAValidResponse(t *testing.T) {
+	var attempts int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "application/json")
+		if attempts < 2 {
+			// Not declared in the spec's Responses: fails validation.
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":"flaky"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	reporter := &recordingReporter{}
+	proxy, err := New(singleGetSwagger("/widgets"), reporter,
+		WithTarget(upstream.URL),
+		WithRetry(2, time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	proxy.Router().ServeHTTP(rec, req)
+
+	if attempts != 2 {
+		t.Errorf("got %d upstream attempts, want 2", attempts)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("got final status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if reporter.retries != 1 {
+		t.Errorf("got %d reported retries, want 1", reporter.retries)
+	}
+	if reporter.successes != 1 {
+		t.Errorf("got %d successes, want 1", reporter.successes)
+	}
+	if len(reporter.errors) != 0 {
+		t.Errorf("got %d errors, want 0 since the retry eventually succeeded", len(reporter.errors))
+	}
+}
+
+func TestRetryExhaustsAttemptsAndSurfacesTheLastFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"down"}`))
+	}))
+	defer upstream.Close()
+
+	reporter := &recordingReporter{}
+	proxy, err := New(singleGetSwagger("/widgets"), reporter,
+		WithTarget(upstream.URL),
+		WithRetry(2, time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/widgets", nil)
+	rec := httptest.NewRecorder()
+	proxy.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got final status %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if reporter.retries != 2 {
+		t.Errorf("got %d reported retries, want 2", reporter.retries)
+	}
+	if len(reporter.errors) != 1 {
+		t.Errorf("got %d errors, want 1 for the final failed attempt", len(reporter.errors))
+	}
+}
@@ -7,13 +7,26 @@ import (
 
 type WriterRecorder struct {
 	http.ResponseWriter
-	status int
-	body   bytes.Buffer
+	status   int
+	body     bytes.Buffer
+	buffered bool
+}
+
+// NewBufferedWriterRecorder returns a WriterRecorder that records the status
+// and body like the zero value does, but defers WriteHeader/Write on the
+// wrapped http.ResponseWriter until Commit is called. This lets a caller
+// (e.g. the retry logic) decide whether a response is the one worth keeping
+// before it reaches the client.
+func NewBufferedWriterRecorder(w http.ResponseWriter) *WriterRecorder {
+	return &WriterRecorder{ResponseWriter: w, buffered: true}
 }
 
 func (w *WriterRecorder) WriteHeader(status int) {
-	w.ResponseWriter.WriteHeader(status)
 	w.status = status
+	if w.buffered {
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
 }
 
 func (w *WriterRecorder) Write(body []byte) (n int, err error) {
@@ -21,6 +34,9 @@ func (w *WriterRecorder) Write(body []byte) (n int, err error) {
 		return n, err
 	}
 
+	if w.buffered {
+		return len(body), nil
+	}
 	return w.ResponseWriter.Write(body)
 }
 
@@ -30,4 +46,20 @@ func (w *WriterRecorder) Body() []byte {
 
 func (w *WriterRecorder) Status() int {
 	return w.status
+}
+
+// Commit flushes a buffered status and body to the wrapped
+// http.ResponseWriter. It is a no-op on a recorder that wasn't created with
+// NewBufferedWriterRecorder.
+func (w *WriterRecorder) Commit() error {
+	if !w.buffered {
+		return nil
+	}
+	w.buffered = false
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
 }
\ No newline at end of file